@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin gates the /v1/cache/* endpoints behind ADMIN_TOKEN. With no
+// token configured the endpoints are disabled outright rather than left
+// open, so operators must opt in to exposing cache administration.
+func (s *apiServer) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.adminToken == "" {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{OK: false, Error: "admin endpoints are disabled: ADMIN_TOKEN is not configured"})
+		return false
+	}
+
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{OK: false, Error: "missing admin token"})
+		return false
+	}
+
+	token := strings.TrimPrefix(header, prefix)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{OK: false, Error: "invalid admin token"})
+		return false
+	}
+
+	return true
+}
+
+func (s *apiServer) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{OK: false, Error: "method not allowed"})
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	stats, err := s.cache.stats()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "failed to read cache stats"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *apiServer) handleCacheByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{OK: false, Error: "method not allowed"})
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	spotifyID := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/v1/cache/"))
+	if spotifyID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "missing spotify id"})
+		return
+	}
+
+	deleted, err := s.cache.delete(spotifyID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "failed to delete cache entry"})
+		return
+	}
+	if !deleted {
+		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "cache entry not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "spotify_id": spotifyID})
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var cacheBucket = []byte("downloads")
+
+// cacheEntry records a previously-downloaded track in the persistent
+// dedup cache, independent of any single request's ephemeral work
+// directory or download token.
+type cacheEntry struct {
+	SpotifyID string    `json:"spotify_id"`
+	Service   string    `json:"service"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Score     float64   `json:"score,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// resultCache is a BoltDB-backed index over a content-addressable
+// directory of completed downloads, keyed by (Spotify track ID, service). It lets a
+// second request for the same track skip re-downloading it from a service
+// entirely.
+type resultCache struct {
+	db  *bolt.DB
+	dir string
+}
+
+func newResultCache(dbPath, dir string) (*resultCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	db, err := bolt.Open(dbPath, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(cacheBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize cache bucket: %w", err)
+	}
+
+	return &resultCache{db: db, dir: dir}, nil
+}
+
+func (c *resultCache) close() error {
+	return c.db.Close()
+}
+
+// cacheKey builds the bolt key for a (spotifyID, service) pair. Every
+// cached result is keyed by this full tuple, not just spotifyID, so a
+// cache hit can never be returned for a service the caller didn't ask for.
+func cacheKey(spotifyID, service string) []byte {
+	return []byte(spotifyID + "\x00" + service)
+}
+
+// get returns a cache hit for (spotifyID, service), but only if its backing
+// file is still present on disk and matches the recorded size. An entry
+// whose file disappeared out from under it (e.g. manual disk cleanup) is
+// treated as a miss rather than handed back as a broken path.
+func (c *resultCache) get(spotifyID, service string) (cacheEntry, bool) {
+	var entry cacheEntry
+	found := false
+
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(cacheBucket).Get(cacheKey(spotifyID, service))
+		if raw == nil {
+			return nil
+		}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil
+		}
+		found = true
+		return nil
+	})
+
+	if !found {
+		return cacheEntry{}, false
+	}
+
+	stat, err := os.Stat(entry.Path)
+	if err != nil || stat.Size() != entry.Size {
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// put copies srcPath into the cache's content-addressable directory and
+// records it, keyed by (spotifyID, service). The copy lands in a
+// uniquely-named temp file and is only renamed onto the final destPath once
+// fully written, so a concurrent get() reading the previous file at that
+// path (e.g. a second request for the same track racing a first one's
+// cache write) never sees a partially-written or truncated file - a rename
+// swaps the directory entry without disturbing readers already holding the
+// old file open. A later successful download for the same (spotifyID,
+// service) overwrites the previous entry; if its file has a different base
+// name, the old file is left orphaned on disk until delete() removes the
+// whole directory.
+func (c *resultCache) put(spotifyID, service, srcPath string, score float64) (cacheEntry, error) {
+	destDir := filepath.Join(c.dir, sanitizeCacheKey(spotifyID), sanitizeCacheKey(service))
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return cacheEntry{}, fmt.Errorf("failed to create cache entry directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(destDir, ".tmp-*")
+	if err != nil {
+		return cacheEntry{}, fmt.Errorf("failed to create temp file in cache: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	size, err := copyFileInto(tmp, srcPath)
+	tmp.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return cacheEntry{}, fmt.Errorf("failed to copy into cache: %w", err)
+	}
+
+	destPath := filepath.Join(destDir, filepath.Base(srcPath))
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return cacheEntry{}, fmt.Errorf("failed to finalize cache entry: %w", err)
+	}
+
+	entry := cacheEntry{
+		SpotifyID: spotifyID,
+		Service:   service,
+		Path:      destPath,
+		Size:      size,
+		Score:     score,
+		CreatedAt: time.Now(),
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cacheBucket).Put(cacheKey(spotifyID, service), raw)
+	}); err != nil {
+		return cacheEntry{}, fmt.Errorf("failed to persist cache entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// delete removes every cached service entry for spotifyID (not just one),
+// along with its backing directory, reporting whether at least one entry
+// existed at all.
+func (c *resultCache) delete(spotifyID string) (bool, error) {
+	prefix := []byte(spotifyID + "\x00")
+	var existed bool
+
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		cur := tx.Bucket(cacheBucket).Cursor()
+		for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+			existed = true
+			if err := cur.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to delete cache entry: %w", err)
+	}
+
+	if existed {
+		_ = os.RemoveAll(filepath.Join(c.dir, sanitizeCacheKey(spotifyID)))
+	}
+
+	return existed, nil
+}
+
+type cacheStats struct {
+	Entries   int   `json:"entries"`
+	TotalSize int64 `json:"total_size_bytes"`
+}
+
+func (c *resultCache) stats() (cacheStats, error) {
+	var stats cacheStats
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(cacheBucket).ForEach(func(_, raw []byte) error {
+			var entry cacheEntry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return nil
+			}
+			stats.Entries++
+			stats.TotalSize += entry.Size
+			return nil
+		})
+	})
+
+	return stats, err
+}
+
+func sanitizeCacheKey(s string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(s)
+}
+
+func copyFile(srcPath, destPath string) (int64, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dest.Close()
+
+	return io.Copy(dest, src)
+}
+
+func copyFileInto(dest *os.File, srcPath string) (int64, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	return io.Copy(dest, src)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+)
+
+// readFLACDurationMS returns the audio duration of a FLAC file in
+// milliseconds, decoded from its STREAMINFO block rather than any tag, so it
+// can't be spoofed by a downloader that writes incorrect metadata.
+func readFLACDurationMS(path string) (int, error) {
+	stream, err := flac.ParseFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse FLAC stream: %w", err)
+	}
+
+	info := stream.Info
+	if info.SampleRate == 0 {
+		return 0, fmt.Errorf("FLAC stream has no sample rate")
+	}
+
+	return int(info.NSamples * 1000 / uint64(info.SampleRate)), nil
+}
+
+// readFLACISRC returns the ISRC embedded in a FLAC file's Vorbis comment
+// block by the downloader (backend/metadata.go writes it under the "ISRC"
+// tag), or "" if the file has no VorbisComment block or no ISRC tag.
+func readFLACISRC(path string) (string, error) {
+	stream, err := flac.ParseFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse FLAC stream: %w", err)
+	}
+
+	for _, block := range stream.Blocks {
+		comment, ok := block.Body.(*meta.VorbisComment)
+		if !ok {
+			continue
+		}
+		for _, tag := range comment.Tags {
+			if strings.EqualFold(tag[0], "ISRC") {
+				return strings.TrimSpace(tag[1]), nil
+			}
+		}
+	}
+
+	return "", nil
+}
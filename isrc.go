@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"spotiflac/backend"
+)
+
+// isrcLookupTimeout bounds how long a single expected-ISRC lookup may block
+// the resolution path. GetISRC enforces its own client-side rate limit
+// (song.link allows roughly 9 calls/minute), so under load a lookup can
+// legitimately queue for several seconds; past this timeout we give up on
+// ISRC for this request rather than stall it, and scoring falls back to the
+// title/artist/duration comparison.
+const isrcLookupTimeout = 4 * time.Second
+
+// songLinkClient is shared process-wide rather than constructed per call,
+// because SongLinkClient tracks its own rate-limit window across calls and a
+// fresh client each time would defeat that throttling. Its methods mutate
+// internal state without locking, so calls are serialized through isrcMu
+// instead of letting concurrent requests race on it.
+var (
+	songLinkClient = backend.NewSongLinkClient()
+	isrcMu         sync.Mutex
+)
+
+// fetchExpectedISRC looks up the ground-truth ISRC for a Spotify track via
+// song.link/Deezer, independent of any download service's own metadata. A
+// failed or timed-out lookup is not an error to the caller: it just means
+// ISRC-based auto-accept isn't available for this request, and
+// matcher.Evaluate falls back to its title/artist/duration scoring.
+func fetchExpectedISRC(spotifyID string) string {
+	result := make(chan string, 1)
+
+	go func() {
+		isrcMu.Lock()
+		defer isrcMu.Unlock()
+		isrc, err := songLinkClient.GetISRC(spotifyID)
+		if err != nil {
+			result <- ""
+			return
+		}
+		result <- strings.TrimSpace(isrc)
+	}()
+
+	select {
+	case isrc := <-result:
+		return isrc
+	case <-time.After(isrcLookupTimeout):
+		return ""
+	}
+}
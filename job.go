@@ -0,0 +1,609 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spotiflac/backend"
+
+	"spotiflacapi/lyrics"
+	"spotiflacapi/matcher"
+)
+
+var (
+	spotifyAlbumRegex    = regexp.MustCompile(`(?i)(?:spotify:album:|https?://open\.spotify\.com/(?:intl-[^/]+/)?album/)([A-Za-z0-9]{22})`)
+	spotifyPlaylistRegex = regexp.MustCompile(`(?i)(?:spotify:playlist:|https?://open\.spotify\.com/(?:intl-[^/]+/)?playlist/)([A-Za-z0-9]{22})`)
+)
+
+type jobItemStatus string
+
+const (
+	jobStatusQueued  jobItemStatus = "queued"
+	jobStatusRunning jobItemStatus = "running"
+	jobStatusDone    jobItemStatus = "done"
+	jobStatusFailed  jobItemStatus = "failed"
+)
+
+type jobTrack struct {
+	SpotifyID   string         `json:"spotify_id"`
+	Name        string         `json:"name"`
+	Artists     string         `json:"artists"`
+	DiscNumber  int            `json:"disc_number"`
+	TrackNumber int            `json:"track_number"`
+	Status      jobItemStatus  `json:"status"`
+	Service     string         `json:"service,omitempty"`
+	Attempts    []attempt      `json:"attempts,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Lyrics      *lyrics.Result `json:"lyrics,omitempty"`
+	LyricsError string         `json:"lyrics_error,omitempty"`
+	path        string
+	index       int
+}
+
+type downloadJob struct {
+	mu        sync.Mutex
+	id        string
+	status    jobItemStatus
+	workDir   string
+	createdAt time.Time
+	expiresAt time.Time
+	tracks    []*jobTrack
+}
+
+type jobSnapshot struct {
+	ID        string        `json:"id"`
+	Status    jobItemStatus `json:"status"`
+	CreatedAt time.Time     `json:"created_at"`
+	Progress  float64       `json:"progress"`
+	Tracks    []jobTrack    `json:"tracks"`
+}
+
+func (j *downloadJob) snapshot() jobSnapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	done := 0
+	tracks := make([]jobTrack, len(j.tracks))
+	for i, t := range j.tracks {
+		tracks[i] = *t
+		if t.Status == jobStatusDone || t.Status == jobStatusFailed {
+			done++
+		}
+	}
+
+	var progress float64
+	if len(j.tracks) > 0 {
+		progress = float64(done) / float64(len(j.tracks))
+	}
+
+	return jobSnapshot{
+		ID:        j.id,
+		Status:    j.status,
+		CreatedAt: j.createdAt,
+		Progress:  progress,
+		Tracks:    tracks,
+	}
+}
+
+// refreshStatus recomputes the overall job status from its tracks.
+// Callers must hold j.mu.
+func (j *downloadJob) refreshStatus() {
+	allTerminal := true
+	anyDone := false
+	anyRunning := false
+
+	for _, t := range j.tracks {
+		switch t.Status {
+		case jobStatusDone:
+			anyDone = true
+		case jobStatusRunning:
+			anyRunning = true
+			allTerminal = false
+		case jobStatusQueued:
+			allTerminal = false
+		}
+	}
+
+	switch {
+	case allTerminal && anyDone:
+		j.status = jobStatusDone
+	case allTerminal:
+		j.status = jobStatusFailed
+	case anyRunning:
+		j.status = jobStatusRunning
+	default:
+		j.status = jobStatusQueued
+	}
+}
+
+type jobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*downloadJob
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*downloadJob)}
+}
+
+func (s *jobStore) put(job *downloadJob) {
+	s.mu.Lock()
+	s.jobs[job.id] = job
+	s.mu.Unlock()
+}
+
+func (s *jobStore) get(id string) (*downloadJob, bool) {
+	s.mu.RLock()
+	job, ok := s.jobs[id]
+	s.mu.RUnlock()
+	return job, ok
+}
+
+// cleanupExpired removes finished jobs past their expiry along with the
+// temp directories holding their downloaded files. Jobs still queued or
+// running are left alone even if expired, so in-flight downloads are
+// never cut out from under their workers.
+func (s *jobStore) cleanupExpired() {
+	now := time.Now()
+	var expired []*downloadJob
+
+	s.mu.RLock()
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		terminal := job.status == jobStatusDone || job.status == jobStatusFailed
+		job.mu.Unlock()
+		if terminal && now.After(job.expiresAt) {
+			expired = append(expired, job)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(expired) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	for _, job := range expired {
+		delete(s.jobs, job.id)
+	}
+	s.mu.Unlock()
+
+	for _, job := range expired {
+		_ = os.RemoveAll(job.workDir)
+	}
+}
+
+func (s *jobStore) startCleanupLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanupExpired()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type jobWorkItem struct {
+	job           *downloadJob
+	track         *jobTrack
+	index         int
+	meta          trackMetadata
+	services      []string
+	matchCfg      matcher.Config
+	cache         *resultCache
+	includeLyrics bool
+	lyricsFormat  lyrics.Format
+}
+
+// dispatchJob hands a job's tracks to the shared worker pool from a
+// dedicated goroutine per job. The send blocks when the shared queue is
+// full, so a large job backs up its own dispatcher instead of stealing
+// buffer space that would otherwise fail a smaller job submitted just
+// after it.
+func (s *apiServer) dispatchJob(job *downloadJob, metas []trackMetadata, serviceOrder []string, matchCfg matcher.Config, includeLyrics bool, lyricsFormat lyrics.Format) {
+	go func() {
+		for i, meta := range metas {
+			item := jobWorkItem{
+				job:           job,
+				track:         job.tracks[i],
+				index:         i,
+				meta:          meta,
+				services:      serviceOrder,
+				matchCfg:      matchCfg,
+				cache:         s.cache,
+				includeLyrics: includeLyrics,
+				lyricsFormat:  lyricsFormat,
+			}
+			select {
+			case s.jobQueue <- item:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func startJobWorkers(ctx context.Context, queue <-chan jobWorkItem, concurrency int) {
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for {
+				select {
+				case item, ok := <-queue:
+					if !ok {
+						return
+					}
+					runJobTrack(item)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func runJobTrack(item jobWorkItem) {
+	job, track := item.job, item.track
+
+	job.mu.Lock()
+	track.Status = jobStatusRunning
+	job.refreshStatus()
+	job.mu.Unlock()
+
+	spotifyURL := "https://open.spotify.com/track/" + track.SpotifyID
+	trackWorkDir := filepath.Join(job.workDir, strconv.Itoa(item.index), track.SpotifyID)
+
+	path, service, attempts, err := resolveMetaWithFallback(context.Background(), item.meta, spotifyURL, item.services, trackWorkDir, item.matchCfg, item.cache, nil, nil)
+
+	var lyricsResult *lyrics.Result
+	var lyricsErr string
+	if err == nil {
+		lyricsResult, lyricsErr = applyLyricsIfRequested(path, item.meta, track.SpotifyID, item.includeLyrics, string(item.lyricsFormat))
+	}
+
+	job.mu.Lock()
+	track.Attempts = attempts
+	track.Lyrics = lyricsResult
+	track.LyricsError = lyricsErr
+	if err != nil {
+		track.Status = jobStatusFailed
+		track.Error = err.Error()
+	} else {
+		track.Status = jobStatusDone
+		track.Service = service
+		track.path = path
+	}
+	job.refreshStatus()
+	job.mu.Unlock()
+}
+
+type createJobRequest struct {
+	SpotifyURL         string   `json:"spotify_url"`
+	Services           []string `json:"services,omitempty"`
+	MinScore           float64  `json:"min_score,omitempty"`
+	MaxDurationDeltaMs int      `json:"max_duration_delta_ms,omitempty"`
+	IncludeLyrics      bool     `json:"include_lyrics,omitempty"`
+	LyricsFormat       string   `json:"lyrics_format,omitempty"`
+}
+
+type createJobResponse struct {
+	OK        bool   `json:"ok"`
+	JobID     string `json:"job_id"`
+	StatusURL string `json:"status_url"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (s *apiServer) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{OK: false, Error: "method not allowed"})
+		return
+	}
+
+	var req createJobRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "invalid JSON body"})
+		return
+	}
+
+	if strings.TrimSpace(req.SpotifyURL) == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "spotify_url is required"})
+		return
+	}
+
+	serviceOrder := normalizeServiceOrder(req.Services)
+	if len(serviceOrder) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "no valid services in services[]"})
+		return
+	}
+
+	kind, spotifyID, err := detectSpotifyResource(req.SpotifyURL)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 90*time.Second)
+	defer cancel()
+
+	var metas []trackMetadata
+	switch kind {
+	case "track":
+		var meta trackMetadata
+		meta, err = fetchTrackMetadata("https://open.spotify.com/track/" + spotifyID)
+		if err == nil {
+			metas = []trackMetadata{meta}
+		}
+	case "album", "playlist":
+		metas, err = fetchAlbumOrPlaylistTracks(ctx, kind, spotifyID)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{OK: false, Error: fmt.Sprintf("failed to expand %s: %v", kind, err)})
+		return
+	}
+
+	workDir, err := os.MkdirTemp("", "spotiflac-job-")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "failed to create job work directory"})
+		return
+	}
+
+	jobID, err := generateToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "failed to generate job id"})
+		return
+	}
+
+	now := time.Now()
+	job := &downloadJob{
+		id:        jobID,
+		status:    jobStatusQueued,
+		workDir:   workDir,
+		createdAt: now,
+		expiresAt: now.Add(s.ttl),
+	}
+
+	for i, meta := range metas {
+		job.tracks = append(job.tracks, &jobTrack{
+			SpotifyID:   meta.SpotifyID,
+			Name:        meta.Name,
+			Artists:     meta.Artists,
+			DiscNumber:  meta.DiscNumber,
+			TrackNumber: meta.TrackNumber,
+			Status:      jobStatusQueued,
+			index:       i,
+		})
+	}
+
+	matchCfg := matcher.Config{MinScore: req.MinScore, MaxDurationDeltaMs: req.MaxDurationDeltaMs}
+
+	s.jobs.put(job)
+	s.dispatchJob(job, metas, serviceOrder, matchCfg, req.IncludeLyrics, lyrics.ParseFormat(req.LyricsFormat))
+
+	writeJSON(w, http.StatusAccepted, createJobResponse{
+		OK:        true,
+		JobID:     job.id,
+		StatusURL: fmt.Sprintf("%s/v1/jobs/%s", s.publicBaseURL(r), job.id),
+	})
+}
+
+func (s *apiServer) handleJobByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{OK: false, Error: "method not allowed"})
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+	if strings.HasSuffix(path, "/archive") {
+		s.handleJobArchive(w, strings.TrimSuffix(path, "/archive"))
+		return
+	}
+
+	s.handleJobStatus(w, strings.TrimSpace(path))
+}
+
+func (s *apiServer) handleJobStatus(w http.ResponseWriter, jobID string) {
+	if jobID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "missing job id"})
+		return
+	}
+
+	job, ok := s.jobs.get(jobID)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "job not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job.snapshot())
+}
+
+func (s *apiServer) handleJobArchive(w http.ResponseWriter, jobID string) {
+	jobID = strings.TrimSpace(jobID)
+	if jobID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "missing job id"})
+		return
+	}
+
+	job, ok := s.jobs.get(jobID)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "job not found"})
+		return
+	}
+
+	job.mu.Lock()
+	var completed []*jobTrack
+	for _, t := range job.tracks {
+		if t.Status == jobStatusDone && t.path != "" {
+			completed = append(completed, t)
+		}
+	}
+	job.mu.Unlock()
+
+	if len(completed) == 0 {
+		writeJSON(w, http.StatusConflict, errorResponse{OK: false, Error: "no completed tracks available yet"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", jobID+".zip"))
+	w.Header().Set("Cache-Control", "no-store")
+
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	for _, t := range completed {
+		if err := addTrackToArchive(zw, t); err != nil {
+			log.Printf("archive: failed to add track %s: %v", t.SpotifyID, err)
+		}
+	}
+}
+
+func addTrackToArchive(zw *zip.Writer, t *jobTrack) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	discDir := fmt.Sprintf("Disc %d", t.DiscNumber)
+	if t.DiscNumber <= 0 {
+		discDir = "Disc 1"
+	}
+
+	// The vendored backend's playlist formatting hardcodes TrackNumber to 0
+	// for every entry (playlists have no intrinsic disc/track numbering the
+	// way albums do), so trusting it verbatim would put every file in a
+	// playlist archive at "Disc 1/00 - <name>" and collide on same-titled
+	// tracks. Fall back to the track's 1-based position in the job, which is
+	// always unique and stable for the archive's lifetime.
+	trackNumber := t.TrackNumber
+	if trackNumber <= 0 {
+		trackNumber = t.index + 1
+	}
+	baseName := fmt.Sprintf("%s/%02d - %s", discDir, trackNumber, sanitizeArchiveName(t.Name))
+
+	entry, err := zw.Create(baseName + filepath.Ext(t.path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, file); err != nil {
+		return err
+	}
+
+	if t.Lyrics != nil && t.Lyrics.LRCPath != "" {
+		if err := addSiblingFileToArchive(zw, t.Lyrics.LRCPath, baseName+".lrc"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSiblingFileToArchive copies a best-effort extra file (e.g. a .lrc
+// written alongside the audio file) into the archive under entryName. A
+// missing file here isn't treated as fatal to the whole archive response -
+// the caller logs it and moves on to the next track.
+func addSiblingFileToArchive(zw *zip.Writer, path, entryName string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := zw.Create(entryName)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+func sanitizeArchiveName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "track"
+	}
+	return strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(name)
+}
+
+func detectSpotifyResource(input string) (kind, id string, err error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", "", fmt.Errorf("spotify URL is empty")
+	}
+
+	if spotifyIDRegex.MatchString(input) {
+		return "track", input, nil
+	}
+	if matches := spotifyTrackRegex.FindStringSubmatch(input); len(matches) == 2 {
+		return "track", matches[1], nil
+	}
+	if matches := spotifyAlbumRegex.FindStringSubmatch(input); len(matches) == 2 {
+		return "album", matches[1], nil
+	}
+	if matches := spotifyPlaylistRegex.FindStringSubmatch(input); len(matches) == 2 {
+		return "playlist", matches[1], nil
+	}
+
+	return "", "", fmt.Errorf("invalid Spotify track, album, or playlist URL or ID")
+}
+
+type albumTracksResponse struct {
+	TrackList []trackMetadata `json:"track_list"`
+}
+
+func fetchAlbumOrPlaylistTracks(ctx context.Context, kind, id string) ([]trackMetadata, error) {
+	url := fmt.Sprintf("https://open.spotify.com/%s/%s", kind, id)
+
+	data, err := backend.GetFilteredSpotifyData(ctx, url, false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload albumTracksResponse
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, err
+	}
+
+	if len(payload.TrackList) == 0 {
+		return nil, fmt.Errorf("no tracks found in %s", kind)
+	}
+
+	return payload.TrackList, nil
+}
+
+func parseWorkerConcurrency() int {
+	const defaultConcurrency = 2
+
+	raw := strings.TrimSpace(os.Getenv("WORKER_CONCURRENCY"))
+	if raw == "" {
+		return defaultConcurrency
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid WORKER_CONCURRENCY %q: must be a positive integer", raw)
+	}
+	return n
+}
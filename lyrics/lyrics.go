@@ -0,0 +1,83 @@
+// Package lyrics fetches lyrics for a downloaded track and applies them as
+// an embedded FLAC/MP3/M4A tag and/or a sibling .lrc file, building on the
+// fetch/convert/embed primitives already exported by the vendored backend's
+// LyricsClient (LRCLIB-backed) and metadata package.
+package lyrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"spotiflac/backend"
+)
+
+// Format controls what Apply writes once lyrics are found.
+type Format string
+
+const (
+	// FormatEmbed embeds lyrics into the audio file's tags. This is the
+	// default when a caller asks for lyrics without naming a format.
+	FormatEmbed Format = "embed"
+	// FormatLRC writes a sibling .lrc file next to the audio file.
+	FormatLRC Format = "lrc"
+	// FormatBoth does both.
+	FormatBoth Format = "both"
+)
+
+// ParseFormat maps a request's raw lyrics_format string onto a Format,
+// defaulting to FormatEmbed for anything unrecognized or empty.
+func ParseFormat(s string) Format {
+	switch Format(strings.ToLower(strings.TrimSpace(s))) {
+	case FormatLRC:
+		return FormatLRC
+	case FormatBoth:
+		return FormatBoth
+	default:
+		return FormatEmbed
+	}
+}
+
+// Result reports what Apply actually did.
+type Result struct {
+	Source   string `json:"source,omitempty"`
+	Embedded bool   `json:"embedded"`
+	LRCPath  string `json:"lrc_path,omitempty"`
+}
+
+// Apply fetches lyrics for (trackName, artistName, durationMs) through the
+// vendored backend's LRCLIB client - which already implements an exact
+// match -> search -> simplified-track-name fallback chain - converts them
+// to LRC, and writes them to audioPath according to format. It's a no-op
+// error, not a panic, when no lyrics are found anywhere: callers should
+// treat that the same as any other best-effort post-download step and not
+// fail the download over it.
+func Apply(audioPath, trackName, artistName, spotifyID string, durationMs int, format Format) (Result, error) {
+	client := backend.NewLyricsClient()
+
+	resp, source, err := client.FetchLyricsAllSources(spotifyID, trackName, artistName, durationMs)
+	if err != nil {
+		return Result{}, err
+	}
+
+	lrc := client.ConvertToLRC(resp, trackName, artistName)
+	result := Result{Source: source}
+
+	if format == FormatEmbed || format == FormatBoth {
+		if err := backend.EmbedLyricsOnlyUniversal(audioPath, lrc); err != nil {
+			return result, fmt.Errorf("failed to embed lyrics: %w", err)
+		}
+		result.Embedded = true
+	}
+
+	if format == FormatLRC || format == FormatBoth {
+		lrcPath := strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ".lrc"
+		if err := os.WriteFile(lrcPath, []byte(lrc), 0o644); err != nil {
+			return result, fmt.Errorf("failed to write .lrc file: %w", err)
+		}
+		result.LRCPath = lrcPath
+	}
+
+	return result, nil
+}
@@ -18,6 +18,9 @@ import (
 	"time"
 
 	"spotiflac/backend"
+
+	"spotiflacapi/lyrics"
+	"spotiflacapi/matcher"
 )
 
 var (
@@ -37,6 +40,7 @@ type trackMetadata struct {
 	Name        string `json:"name"`
 	AlbumName   string `json:"album_name"`
 	AlbumArtist string `json:"album_artist"`
+	DurationMS  int    `json:"duration_ms"`
 	Images      string `json:"images"`
 	ReleaseDate string `json:"release_date"`
 	TrackNumber int    `json:"track_number"`
@@ -52,25 +56,34 @@ type trackResponse struct {
 }
 
 type attempt struct {
-	Service string `json:"service"`
-	Error   string `json:"error,omitempty"`
+	Service string         `json:"service"`
+	Error   string         `json:"error,omitempty"`
+	Score   *matcher.Score `json:"score,omitempty"`
 }
 
 type createDownloadRequest struct {
-	SpotifyURL string   `json:"spotify_url"`
-	Services   []string `json:"services,omitempty"`
-	TTLSeconds int      `json:"ttl_seconds,omitempty"`
+	SpotifyURL         string   `json:"spotify_url"`
+	Services           []string `json:"services,omitempty"`
+	TTLSeconds         int      `json:"ttl_seconds,omitempty"`
+	MinScore           float64  `json:"min_score,omitempty"`
+	MaxDurationDeltaMs int      `json:"max_duration_delta_ms,omitempty"`
+	IncludeLyrics      bool     `json:"include_lyrics,omitempty"`
+	LyricsFormat       string   `json:"lyrics_format,omitempty"`
+	Mode               string   `json:"mode,omitempty"`
 }
 
 type createDownloadResponse struct {
-	OK          bool      `json:"ok"`
-	SpotifyID   string    `json:"spotify_id,omitempty"`
-	Service     string    `json:"service,omitempty"`
-	Filename    string    `json:"filename,omitempty"`
-	DownloadURL string    `json:"download_url,omitempty"`
-	ExpiresAt   time.Time `json:"expires_at,omitempty"`
-	Attempts    []attempt `json:"attempts,omitempty"`
-	Error       string    `json:"error,omitempty"`
+	OK             bool           `json:"ok"`
+	SpotifyID      string         `json:"spotify_id,omitempty"`
+	Service        string         `json:"service,omitempty"`
+	Filename       string         `json:"filename,omitempty"`
+	DownloadURL    string         `json:"download_url,omitempty"`
+	ExpiresAt      time.Time      `json:"expires_at,omitempty"`
+	Attempts       []attempt      `json:"attempts,omitempty"`
+	Lyrics         *lyrics.Result `json:"lyrics,omitempty"`
+	LyricsError    string         `json:"lyrics_error,omitempty"`
+	LRCDownloadURL string         `json:"lrc_download_url,omitempty"`
+	Error          string         `json:"error,omitempty"`
 }
 
 type errorResponse struct {
@@ -175,9 +188,15 @@ func (s *downloadStore) startCleanupLoop(ctx context.Context, interval time.Dura
 }
 
 type apiServer struct {
-	store   *downloadStore
-	baseURL string
-	ttl     time.Duration
+	store      *downloadStore
+	jobs       *jobStore
+	jobQueue   chan jobWorkItem
+	cache      *resultCache
+	adminToken string
+	signingKey []byte
+	baseURL    string
+	ttl        time.Duration
+	ctx        context.Context
 }
 
 func main() {
@@ -198,20 +217,46 @@ func main() {
 		ttl = parsed
 	}
 
-	server := &apiServer{
-		store:   newDownloadStore(),
-		baseURL: strings.TrimSpace(os.Getenv("BASE_URL")),
-		ttl:     ttl,
+	workerConcurrency := parseWorkerConcurrency()
+
+	cacheDir := strings.TrimSpace(os.Getenv("CACHE_DIR"))
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "spotiflac-cache")
+	}
+	cache, err := newResultCache(filepath.Join(cacheDir, "index.db"), filepath.Join(cacheDir, "files"))
+	if err != nil {
+		log.Fatalf("failed to open result cache: %v", err)
 	}
+	defer cache.close()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+
+	server := &apiServer{
+		store:      newDownloadStore(),
+		jobs:       newJobStore(),
+		jobQueue:   make(chan jobWorkItem, workerConcurrency*4),
+		cache:      cache,
+		adminToken: strings.TrimSpace(os.Getenv("ADMIN_TOKEN")),
+		signingKey: []byte(os.Getenv("DOWNLOAD_SIGNING_KEY")),
+		baseURL:    strings.TrimSpace(os.Getenv("BASE_URL")),
+		ttl:        ttl,
+		ctx:        ctx,
+	}
+
 	go server.store.startCleanupLoop(ctx, 1*time.Minute)
+	go server.jobs.startCleanupLoop(ctx, 1*time.Minute)
+	startJobWorkers(ctx, server.jobQueue, workerConcurrency)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", server.handleHealth)
 	mux.HandleFunc("/v1/download-url", server.handleCreateDownloadURL)
+	mux.HandleFunc("/v1/download-url/stream", server.handleDownloadURLStream)
 	mux.HandleFunc("/v1/download/", server.handleDownloadByToken)
+	mux.HandleFunc("/v1/jobs", server.handleCreateJob)
+	mux.HandleFunc("/v1/jobs/", server.handleJobByID)
+	mux.HandleFunc("/v1/cache/stats", server.handleCacheStats)
+	mux.HandleFunc("/v1/cache/", server.handleCacheByID)
 	mux.HandleFunc("/", server.handleRoot)
 
 	httpServer := &http.Server{
@@ -223,6 +268,7 @@ func main() {
 
 	log.Printf("REST API listening on http://localhost:%s", port)
 	log.Printf("Token TTL: %s", ttl)
+	log.Printf("Job worker concurrency: %d", workerConcurrency)
 	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server error: %v", err)
 	}
@@ -238,9 +284,20 @@ func (s *apiServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"name":      "SpotiFLAC REST API",
-		"version":   "1",
-		"endpoints": []string{"GET /health", "POST /v1/download-url", "GET /v1/download/{token}"},
+		"name":    "SpotiFLAC REST API",
+		"version": "1",
+		"endpoints": []string{
+			"GET /health",
+			"POST /v1/download-url",
+			"GET /v1/download-url/stream",
+			"GET /v1/download/{token}",
+			"GET /v1/download/{spotify_id}/{service} (signed mode)",
+			"POST /v1/jobs",
+			"GET /v1/jobs/{id}",
+			"GET /v1/jobs/{id}/archive",
+			"GET /v1/cache/stats",
+			"DELETE /v1/cache/{spotify_id}",
+		},
 	})
 }
 
@@ -276,6 +333,16 @@ func (s *apiServer) handleCreateDownloadURL(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	mode, err := parseDownloadMode(req.Mode)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: err.Error()})
+		return
+	}
+	if mode == modeSigned && len(s.signingKey) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "mode \"signed\" requires DOWNLOAD_SIGNING_KEY to be configured"})
+		return
+	}
+
 	ttl := s.ttl
 	if req.TTLSeconds > 0 {
 		override := time.Duration(req.TTLSeconds) * time.Second
@@ -285,7 +352,9 @@ func (s *apiServer) handleCreateDownloadURL(w http.ResponseWriter, r *http.Reque
 		ttl = override
 	}
 
-	downloadPath, serviceUsed, spotifyID, attempts, err := resolveWithFallback(req.SpotifyURL, serviceOrder)
+	matchCfg := matcher.Config{MinScore: req.MinScore, MaxDurationDeltaMs: req.MaxDurationDeltaMs}
+
+	downloadPath, serviceUsed, spotifyID, meta, attempts, err := resolveWithFallback(r.Context(), req.SpotifyURL, serviceOrder, matchCfg, s.cache, nil, nil)
 	if err != nil {
 		writeJSON(w, http.StatusBadGateway, createDownloadResponse{
 			OK:       false,
@@ -295,24 +364,70 @@ func (s *apiServer) handleCreateDownloadURL(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if mode == modeSigned {
+		resp, err := s.signedDownloadResponse(r, spotifyID, serviceUsed, downloadPath, attempts, req.IncludeLyrics, ttl)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// Apply lyrics before minting the download token so a slow LRCLIB
+	// fetch or tag-embed can't eat into the token's TTL before the
+	// caller has even received it.
+	lyricsResult, lyricsErr := applyLyricsIfRequested(downloadPath, meta, spotifyID, req.IncludeLyrics, req.LyricsFormat)
+
 	entry, err := s.store.put(downloadPath, serviceUsed, spotifyID, ttl)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "failed to generate download token"})
 		return
 	}
 
+	var lrcDownloadURL string
+	if lyricsResult != nil && lyricsResult.LRCPath != "" {
+		lrcEntry, err := s.store.put(lyricsResult.LRCPath, serviceUsed, spotifyID, ttl)
+		if err == nil {
+			lrcDownloadURL = fmt.Sprintf("%s/v1/download/%s", s.publicBaseURL(r), lrcEntry.Token)
+		}
+	}
+
 	downloadURL := fmt.Sprintf("%s/v1/download/%s", s.publicBaseURL(r), entry.Token)
 	writeJSON(w, http.StatusOK, createDownloadResponse{
-		OK:          true,
-		SpotifyID:   spotifyID,
-		Service:     serviceUsed,
-		Filename:    filepath.Base(entry.Path),
-		DownloadURL: downloadURL,
-		ExpiresAt:   entry.ExpiresAt.UTC(),
-		Attempts:    attempts,
+		OK:             true,
+		SpotifyID:      spotifyID,
+		Service:        serviceUsed,
+		Filename:       filepath.Base(entry.Path),
+		DownloadURL:    downloadURL,
+		ExpiresAt:      entry.ExpiresAt.UTC(),
+		Attempts:       attempts,
+		Lyrics:         lyricsResult,
+		LyricsError:    lyricsErr,
+		LRCDownloadURL: lrcDownloadURL,
 	})
 }
 
+// applyLyricsIfRequested is a thin wrapper shared by the single-track and
+// job download paths: it no-ops when includeLyrics is false, and otherwise
+// turns a lyrics.Apply call into the (*lyrics.Result, errorString) shape
+// both callers attach to their JSON response.
+func applyLyricsIfRequested(path string, meta trackMetadata, spotifyID string, includeLyrics bool, rawFormat string) (*lyrics.Result, string) {
+	if !includeLyrics {
+		return nil, ""
+	}
+
+	result, err := lyrics.Apply(path, meta.Name, meta.Artists, spotifyID, meta.DurationMS, lyrics.ParseFormat(rawFormat))
+	if err != nil {
+		return nil, err.Error()
+	}
+	return &result, ""
+}
+
+// handleDownloadByToken serves GET /v1/download/{...}, dispatching on the
+// path shape: a single segment is a server-side token minted by
+// downloadStore; two segments ({spotify_id}/{service}) is a self-verifying
+// signed URL that needs no server-side state at all (see signing.go).
 func (s *apiServer) handleDownloadByToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{OK: false, Error: "method not allowed"})
@@ -325,12 +440,44 @@ func (s *apiServer) handleDownloadByToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	token := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, prefix))
-	if token == "" {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if rest == "" {
 		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "missing token"})
 		return
 	}
 
+	parts := strings.Split(rest, "/")
+	switch len(parts) {
+	case 1:
+		s.handleDownloadByTokenValue(w, r, parts[0])
+	case 2:
+		s.handleSignedDownload(w, r, parts[0], parts[1])
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "route not found"})
+	}
+}
+
+// handleDownloadByTokenValue streams a completed download identified by a
+// server-minted token, honoring Range and If-Range request headers via
+// http.ServeContent so clients can resume an interrupted transfer instead of
+// restarting from byte zero.
+//
+// This only covers files that have already finished downloading, by which
+// point a token exists at all (tokens are minted after resolveWithFallback
+// returns, see handleCreateDownloadURL). Concurrent requests for the same track
+// made *before* that point - e.g. two callers racing to resolve the same
+// Spotify URL - already share a single in-flight backend fetch instead of
+// each downloading it independently; see resolveMetaWithFallback's use of
+// pipeStore in pipestore.go.
+//
+// What's still not possible here is Range/resumable serving of a file that
+// is itself still being downloaded: a Range response requires declaring the
+// resource's total length up front (Content-Range's "/total"), but the final
+// size of a FLAC/MP3 produced by the backend's own encode step isn't known
+// until that encode finishes - there's no placeholder or expected-size hint
+// from the vendored downloaders to serve one from. That's the concrete
+// blocker, not a general "can't be done without changing the backend."
+func (s *apiServer) handleDownloadByTokenValue(w http.ResponseWriter, r *http.Request, token string) {
 	entry, ok := s.store.get(token)
 	if !ok {
 		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "invalid or expired token"})
@@ -343,21 +490,30 @@ func (s *apiServer) handleDownloadByToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	file, err := os.Open(entry.Path)
-	if err != nil {
+	if !serveDownloadFile(w, r, entry.Path) {
 		s.store.delete(token)
+	}
+}
+
+// serveDownloadFile opens path and streams it with Range/If-Range support
+// via http.ServeContent, reporting whether it succeeded so a caller backed
+// by a server-side record (like a token) can invalidate that record when
+// the file has gone missing out from under it.
+func serveDownloadFile(w http.ResponseWriter, r *http.Request, path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
 		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "file no longer available"})
-		return
+		return false
 	}
 	defer file.Close()
 
 	info, err := file.Stat()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "unable to read file metadata"})
-		return
+		return false
 	}
 
-	filename := filepath.Base(entry.Path)
+	filename := filepath.Base(path)
 	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
 	if contentType == "" {
 		contentType = "application/octet-stream"
@@ -368,55 +524,192 @@ func (s *apiServer) handleDownloadByToken(w http.ResponseWriter, r *http.Request
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
 	w.Header().Set("Cache-Control", "no-store")
 	http.ServeContent(w, r, filename, info.ModTime(), file)
+	return true
 }
 
-func resolveWithFallback(spotifyInput string, serviceOrder []string) (downloadPath, serviceUsed, spotifyID string, attempts []attempt, err error) {
+// onAttempt, when non-nil, is invoked synchronously as each attempt is
+// recorded (including a cache hit), so a caller like the SSE stream handler
+// can surface per-service progress as it happens rather than only once the
+// whole resolution finishes.
+//
+// ctx is checked between service attempts so a caller backed by a request
+// context (e.g. the SSE stream handler) stops trying further services once
+// the client has gone away, instead of downloading from every remaining
+// service for a response nobody will read.
+func resolveWithFallback(ctx context.Context, spotifyInput string, serviceOrder []string, matchCfg matcher.Config, cache *resultCache, onAttempt func(attempt), onProgress func(service string, bytesWritten int64)) (downloadPath, serviceUsed, spotifyID string, meta trackMetadata, attempts []attempt, err error) {
 	spotifyID, err = extractSpotifyTrackID(spotifyInput)
 	if err != nil {
-		return "", "", "", nil, err
+		return "", "", "", trackMetadata{}, nil, err
 	}
 
 	spotifyURL := "https://open.spotify.com/track/" + spotifyID
-	meta, err := fetchTrackMetadata(spotifyURL)
+	meta, err = fetchTrackMetadata(spotifyURL)
 	if err != nil {
-		return "", "", spotifyID, nil, fmt.Errorf("failed to fetch Spotify metadata: %w", err)
+		return "", "", spotifyID, trackMetadata{}, nil, fmt.Errorf("failed to fetch Spotify metadata: %w", err)
 	}
 
 	workDir, err := os.MkdirTemp("", "spotiflac-rest-")
 	if err != nil {
-		return "", "", spotifyID, nil, fmt.Errorf("failed to create temp directory: %w", err)
+		return "", "", spotifyID, meta, nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
+	downloadPath, serviceUsed, attempts, err = resolveMetaWithFallback(ctx, meta, spotifyURL, serviceOrder, workDir, matchCfg, cache, onAttempt, onProgress)
+	if err != nil {
+		_ = os.RemoveAll(workDir)
+		return "", "", spotifyID, meta, attempts, err
+	}
+
+	return downloadPath, serviceUsed, spotifyID, meta, attempts, nil
+}
+
+// resolveMetaWithFallback tries each service in order, scoring the downloaded
+// file against the requested Spotify metadata with the matcher package. A
+// service result that downloads cleanly but scores below matchCfg's
+// threshold is treated the same as a download error: it's recorded in
+// attempts and the next service is tried.
+//
+// When cache is non-nil, a prior accepted download for the same (Spotify ID,
+// service) is copied straight into workDir and returned without touching
+// that service, and a fresh accepted download is written through to the
+// cache for the next caller. A cache hit is only used if its recorded final
+// score still clears matchCfg's current min_score, so a caller that raises
+// min_score on a repeat request never gets handed back a result below it.
+// The hit is not re-scored: its recorded score was computed with the
+// max_duration_delta_ms of the request that stored it, so tightening
+// max_duration_delta_ms alone does not reject a cached result. cache may be
+// nil to opt out of dedup entirely.
+//
+// Note on score quality: the vendored backend downloaders embed the exact
+// Spotify title/artist we pass them into the output file's tags, so a
+// post-download tag read is not an independent signal for Title/Artist —
+// those scores are effectively always ~1.0. Duration, read from the decoded
+// FLAC stream rather than its tags, is an independent signal. ISRC is too:
+// each downloader sources its own ISRC from its own service and embeds it in
+// the file's tags, compared against the ground-truth ISRC fetched separately
+// via song.link/Deezer (fetchExpectedISRC) — an ISRC match on both sides
+// auto-accepts regardless of the title/artist/duration scores.
+func resolveMetaWithFallback(ctx context.Context, meta trackMetadata, spotifyURL string, serviceOrder []string, workDir string, matchCfg matcher.Config, cache *resultCache, onAttempt func(attempt), onProgress func(service string, bytesWritten int64)) (downloadPath, serviceUsed string, attempts []attempt, err error) {
+	record := func(a attempt) {
+		attempts = append(attempts, a)
+		if onAttempt != nil {
+			onAttempt(a)
+		}
+	}
+
+	// expectedISRC is fetched at most once, lazily, the first time a service
+	// actually downloads a file that needs scoring - not unconditionally up
+	// front, so a request that's fully satisfied by cache hits never pays for
+	// the song.link round trip.
+	var expectedISRC string
+	var isrcFetched bool
+
 	for _, service := range serviceOrder {
+		if ctx.Err() != nil {
+			return "", "", attempts, ctx.Err()
+		}
+
+		if cache != nil {
+			if hit, ok := cache.get(meta.SpotifyID, service); ok {
+				if hit.Score < matchCfg.WithDefaults().MinScore {
+					record(attempt{Service: service, Error: "cache hit below current match threshold, re-downloading"})
+				} else if cachedPath, copyErr := copyCacheHitIntoWorkDir(hit, workDir); copyErr == nil {
+					record(attempt{Service: service})
+					return cachedPath, service, attempts, nil
+				} else {
+					record(attempt{Service: service, Error: fmt.Sprintf("cache hit unusable: %v", copyErr)})
+				}
+			}
+		}
+
 		serviceDir := filepath.Join(workDir, service)
-		filename, dlErr := runServiceDownload(service, spotifyID, spotifyURL, meta, serviceDir)
+		pipeKey := meta.SpotifyID + "\x00" + service
+		filename, dlErr := sharedPipes.runDownloadDeduped(pipeKey, serviceDir, func(bytesWritten int64) {
+			if onProgress != nil {
+				onProgress(service, bytesWritten)
+			}
+		}, func() (string, error) {
+			path, err := runServiceDownload(service, meta.SpotifyID, spotifyURL, meta, serviceDir)
+			return strings.TrimPrefix(path, "EXISTS:"), err
+		})
 		if dlErr != nil {
-			attempts = append(attempts, attempt{Service: service, Error: dlErr.Error()})
+			record(attempt{Service: service, Error: dlErr.Error()})
 			continue
 		}
 
-		filename = strings.TrimPrefix(filename, "EXISTS:")
 		if filename == "" {
-			attempts = append(attempts, attempt{Service: service, Error: "empty file path returned"})
+			record(attempt{Service: service, Error: "empty file path returned"})
 			continue
 		}
 
 		stat, statErr := os.Stat(filename)
 		if statErr != nil {
-			attempts = append(attempts, attempt{Service: service, Error: fmt.Sprintf("downloaded file missing: %v", statErr)})
+			record(attempt{Service: service, Error: fmt.Sprintf("downloaded file missing: %v", statErr)})
 			continue
 		}
 		if stat.Size() <= 0 {
-			attempts = append(attempts, attempt{Service: service, Error: "downloaded file is empty"})
+			record(attempt{Service: service, Error: "downloaded file is empty"})
 			continue
 		}
 
-		attempts = append(attempts, attempt{Service: service})
-		return filename, service, spotifyID, attempts, nil
+		if !isrcFetched {
+			expectedISRC = fetchExpectedISRC(meta.SpotifyID)
+			isrcFetched = true
+		}
+
+		score := scoreDownload(meta, filename, matchCfg, expectedISRC)
+		if !score.Accepted {
+			record(attempt{Service: service, Error: "match score below threshold", Score: &score})
+			continue
+		}
+
+		if cache != nil {
+			if _, err := cache.put(meta.SpotifyID, service, filename, score.Final); err != nil {
+				log.Printf("cache: failed to store %s: %v", meta.SpotifyID, err)
+			}
+		}
+
+		record(attempt{Service: service, Score: &score})
+		return filename, service, attempts, nil
+	}
+
+	return "", "", attempts, fmt.Errorf("failed in all services: %s", strings.Join(serviceOrder, " -> "))
+}
+
+// copyCacheHitIntoWorkDir copies a cached file into this request's own work
+// directory so its lifetime (and eventual cleanup) follows the same rules
+// as a freshly-downloaded file, leaving the shared cache copy untouched.
+func copyCacheHitIntoWorkDir(hit cacheEntry, workDir string) (string, error) {
+	destDir := filepath.Join(workDir, hit.Service)
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return "", err
 	}
 
-	_ = os.RemoveAll(workDir)
-	return "", "", spotifyID, attempts, fmt.Errorf("failed in all services: %s", strings.Join(serviceOrder, " -> "))
+	destPath := filepath.Join(destDir, filepath.Base(hit.Path))
+	if _, err := copyFile(hit.Path, destPath); err != nil {
+		return "", err
+	}
+
+	return destPath, nil
+}
+
+// scoreDownload evaluates a downloaded file against the requested metadata.
+// readFLACDurationMS errors (e.g. a non-FLAC output) are not fatal: the
+// candidate's duration is simply left at zero, which matcher.Evaluate treats
+// as "unknown" and scores as a full match rather than a rejection. The same
+// holds for readFLACISRC: a file with no embedded ISRC tag just scores on
+// title/artist/duration instead of auto-accepting.
+//
+// expectedISRC is the ground-truth ISRC for the requested Spotify track
+// (fetched independently of any service, see fetchExpectedISRC) and may be
+// empty if that lookup failed or was skipped.
+func scoreDownload(meta trackMetadata, path string, matchCfg matcher.Config, expectedISRC string) matcher.Score {
+	durationMS, _ := readFLACDurationMS(path)
+	candidateISRC, _ := readFLACISRC(path)
+
+	expected := matcher.Candidate{Title: meta.Name, Artist: meta.Artists, DurationMS: meta.DurationMS, ISRC: expectedISRC}
+	candidate := matcher.Candidate{Title: meta.Name, Artist: meta.Artists, DurationMS: durationMS, ISRC: candidateISRC}
+
+	return matcher.Evaluate(expected, candidate, matchCfg)
 }
 
 func runServiceDownload(service, spotifyID, spotifyURL string, meta trackMetadata, outputDir string) (string, error) {
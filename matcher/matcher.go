@@ -0,0 +1,171 @@
+// Package matcher scores a downloaded candidate track against the Spotify
+// metadata that was requested, so resolveWithFallback can reject a poorly
+// matching file instead of accepting the first file that downloads. Services
+// are still tried in order and the first candidate that clears the threshold
+// is used; later services are not tried in search of a higher score.
+package matcher
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultMinScore is the minimum Final score a candidate must reach to be
+// accepted when the caller does not supply an explicit threshold.
+const DefaultMinScore = 0.75
+
+// DefaultMaxDurationDeltaMs is the duration delta, in milliseconds, beyond
+// which durationScore bottoms out at zero.
+const DefaultMaxDurationDeltaMs = 5000
+
+// Candidate holds the fields compared between the requested Spotify track
+// and a service's downloaded result.
+type Candidate struct {
+	Title      string
+	Artist     string
+	DurationMS int
+	ISRC       string
+}
+
+// Config controls acceptance thresholds for Evaluate.
+type Config struct {
+	MinScore           float64
+	MaxDurationDeltaMs int
+}
+
+// WithDefaults fills in zero fields with the package defaults.
+func (c Config) WithDefaults() Config {
+	if c.MinScore <= 0 {
+		c.MinScore = DefaultMinScore
+	}
+	if c.MaxDurationDeltaMs <= 0 {
+		c.MaxDurationDeltaMs = DefaultMaxDurationDeltaMs
+	}
+	return c
+}
+
+// Score is the result of comparing a candidate against the expected track.
+type Score struct {
+	Title     float64 `json:"title"`
+	Artist    float64 `json:"artist"`
+	Duration  float64 `json:"duration"`
+	Final     float64 `json:"final"`
+	ISRCMatch bool    `json:"isrc_match,omitempty"`
+	Accepted  bool    `json:"accepted"`
+}
+
+var parentheticalRegex = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+var punctuationRegex = regexp.MustCompile(`[^\p{L}\p{N}\s]`)
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// Normalize lowercases s, strips parentheticals like "(Remastered)",
+// removes punctuation, and collapses whitespace so title/artist comparisons
+// aren't thrown off by formatting differences between services.
+func Normalize(s string) string {
+	s = strings.ToLower(s)
+	s = parentheticalRegex.ReplaceAllString(s, "")
+	s = punctuationRegex.ReplaceAllString(s, "")
+	s = whitespaceRegex.ReplaceAllString(s, " ")
+	return strings.TrimSpace(s)
+}
+
+// Evaluate scores candidate against expected and reports whether it clears
+// cfg's thresholds. An ISRC match on both sides auto-accepts with a final
+// score of 1.0, matching the spec's "ISRC match = 1.0 auto-accept" rule.
+func Evaluate(expected, candidate Candidate, cfg Config) Score {
+	cfg = cfg.WithDefaults()
+
+	if expected.ISRC != "" && candidate.ISRC != "" && expected.ISRC == candidate.ISRC {
+		return Score{Title: 1, Artist: 1, Duration: 1, Final: 1, ISRCMatch: true, Accepted: true}
+	}
+
+	titleScore := stringScore(expected.Title, candidate.Title)
+	artistScore := stringScore(expected.Artist, candidate.Artist)
+	durationScore := durationScore(expected.DurationMS, candidate.DurationMS, cfg.MaxDurationDeltaMs)
+
+	final := 0.5*titleScore + 0.3*artistScore + 0.2*durationScore
+
+	return Score{
+		Title:    titleScore,
+		Artist:   artistScore,
+		Duration: durationScore,
+		Final:    final,
+		Accepted: final >= cfg.MinScore,
+	}
+}
+
+func stringScore(a, b string) float64 {
+	a, b = Normalize(a), Normalize(b)
+	if a == "" && b == "" {
+		return 1
+	}
+	maxLen := len(a)
+	if len(b) > maxLen {
+		maxLen = len(b)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(maxLen)
+}
+
+func durationScore(expectedMS, candidateMS, maxDeltaMs int) float64 {
+	if expectedMS <= 0 || candidateMS <= 0 {
+		return 1
+	}
+	delta := expectedMS - candidateMS
+	if delta < 0 {
+		delta = -delta
+	}
+	score := 1 - float64(delta)/float64(maxDeltaMs)
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// levenshtein returns the edit distance between a and b, operating on runes
+// so multi-byte characters count as a single edit.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			del := prev[j] + 1
+			ins := curr[j-1] + 1
+			sub := prev[j-1] + cost
+			curr[j] = min3(del, ins, sub)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
@@ -0,0 +1,131 @@
+package matcher
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"lowercases", "HELLO", "hello"},
+		{"strips parentheticals", "Hello (Remastered 2011)", "hello"},
+		{"strips brackets", "Hello [Live]", "hello"},
+		{"strips punctuation", "Don't Stop Me Now!", "dont stop me now"},
+		{"collapses whitespace", "hello    world  ", "hello world"},
+		{"empty string", "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Normalize(c.in); got != c.want {
+				t.Errorf("Normalize(%q) = %q, want %q", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestStringScore(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"identical", "Hello World", "Hello World", 1},
+		{"identical after normalize", "Hello (Remastered)", "hello", 1},
+		{"both empty", "", "", 1},
+		{"completely different", "abc", "xyz", 0},
+		{"one empty", "", "abc", 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := stringScore(c.a, c.b); got != c.want {
+				t.Errorf("stringScore(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+			}
+		})
+	}
+}
+
+func TestDurationScore(t *testing.T) {
+	cases := []struct {
+		name                string
+		expected, candidate int
+		maxDelta            int
+		want                float64
+	}{
+		{"exact match", 200000, 200000, 5000, 1},
+		{"expected unknown", 0, 200000, 5000, 1},
+		{"candidate unknown", 200000, 0, 5000, 1},
+		{"half delta", 200000, 202500, 5000, 0.5},
+		{"beyond max delta floors at zero", 200000, 300000, 5000, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := durationScore(c.expected, c.candidate, c.maxDelta); got != c.want {
+				t.Errorf("durationScore(%d, %d, %d) = %v, want %v", c.expected, c.candidate, c.maxDelta, got, c.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Run("exact match accepted", func(t *testing.T) {
+		expected := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000}
+		candidate := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000}
+
+		score := Evaluate(expected, candidate, Config{})
+		if !score.Accepted {
+			t.Errorf("expected exact match to be accepted, got score %+v", score)
+		}
+		if score.Final != 1 {
+			t.Errorf("expected final score 1, got %v", score.Final)
+		}
+	})
+
+	t.Run("isrc match auto-accepts despite mismatched title", func(t *testing.T) {
+		expected := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000, ISRC: "USRC17607839"}
+		candidate := Candidate{Title: "Completely Different Title", Artist: "Other Artist", DurationMS: 1, ISRC: "USRC17607839"}
+
+		score := Evaluate(expected, candidate, Config{})
+		if !score.Accepted || !score.ISRCMatch || score.Final != 1 {
+			t.Errorf("expected ISRC match to auto-accept with final score 1, got %+v", score)
+		}
+	})
+
+	t.Run("mismatched isrc does not auto-accept", func(t *testing.T) {
+		expected := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000, ISRC: "USRC17607839"}
+		candidate := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000, ISRC: "GBUM71029605"}
+
+		score := Evaluate(expected, candidate, Config{})
+		if score.ISRCMatch {
+			t.Errorf("expected ISRCMatch to be false for mismatched ISRCs, got %+v", score)
+		}
+	})
+
+	t.Run("poor match rejected", func(t *testing.T) {
+		expected := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000}
+		candidate := Candidate{Title: "Totally Unrelated Track", Artist: "Nobody", DurationMS: 400000}
+
+		score := Evaluate(expected, candidate, Config{})
+		if score.Accepted {
+			t.Errorf("expected poor match to be rejected, got score %+v", score)
+		}
+	})
+
+	t.Run("threshold boundary honors custom min score", func(t *testing.T) {
+		expected := Candidate{Title: "Song", Artist: "Artist", DurationMS: 200000}
+		candidate := Candidate{Title: "Song", Artist: "Artust", DurationMS: 200000}
+
+		score := Evaluate(expected, candidate, Config{MinScore: 1})
+		if score.Accepted {
+			t.Errorf("expected a near-but-not-perfect match to be rejected against MinScore 1, got %+v", score)
+		}
+
+		score = Evaluate(expected, candidate, Config{MinScore: score.Final})
+		if !score.Accepted {
+			t.Errorf("expected match to be accepted when MinScore equals its own final score, got %+v", score)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pipePollInterval is how often a pipeFetch re-stats its output directory
+// while a download is in flight.
+const pipePollInterval = 250 * time.Millisecond
+
+// pipeFetch tracks a single in-flight download writing into dir, so anyone
+// waiting on it can observe its growing size instead of blocking blind.
+//
+// The vendored backend's Download/DownloadTrack/DownloadBySpotifyID calls
+// take an output directory and return only once the whole file is written -
+// there is no in-process hook to push bytes-done as they're produced. So
+// progress here is polled off the growing output directory's total size from
+// the outside, on a ticker, rather than pushed by the downloader itself;
+// that needs no change to those vendored signatures.
+type pipeFetch struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	dir  string
+	size int64
+	done bool
+	path string
+	err  error
+}
+
+func newPipeFetch(dir string) *pipeFetch {
+	f := &pipeFetch{dir: dir}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// pollUntilDone re-stats f.dir every pipePollInterval and broadcasts every
+// waiter whenever its total size has grown, until stop is closed.
+func (f *pipeFetch) pollUntilDone(stop <-chan struct{}) {
+	ticker := time.NewTicker(pipePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			size := dirSize(f.dir)
+			f.mu.Lock()
+			if size > f.size {
+				f.size = size
+				f.cond.Broadcast()
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// finish records the terminal result and wakes every current and future
+// waiter, so a wait() call racing the last broadcast still observes
+// completion instead of blocking forever.
+func (f *pipeFetch) finish(path string, err error) {
+	f.mu.Lock()
+	f.path = path
+	f.err = err
+	f.done = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// wait blocks until the download this fetch represents finishes, calling
+// onProgress (if non-nil) each time the tracked directory's size changes in
+// the meantime, and returns the same (path, err) the leader's download call
+// produced.
+func (f *pipeFetch) wait(onProgress func(bytesWritten int64)) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lastSeen := int64(-1)
+	for !f.done {
+		if f.size != lastSeen {
+			lastSeen = f.size
+			if onProgress != nil {
+				onProgress(f.size)
+			}
+		}
+		f.cond.Wait()
+	}
+	if onProgress != nil {
+		onProgress(f.size)
+	}
+	return f.path, f.err
+}
+
+// pipeStore deduplicates concurrent downloads of the same (spotifyID,
+// service) pair: the first caller to reach runDownloadDeduped for a given
+// key becomes the leader and runs the real backend download; any caller
+// that arrives while it's still in flight joins as a follower, waits on the
+// leader's pipeFetch instead of starting a redundant fetch of its own, and
+// copies the leader's finished file into its own output directory once it's
+// ready. If the leader's download fails, every follower waiting on it gets
+// that same failure rather than each retrying independently - sharing one
+// fetch means sharing its outcome too.
+type pipeStore struct {
+	mu       sync.Mutex
+	inFlight map[string]*pipeFetch
+}
+
+func newPipeStore() *pipeStore {
+	return &pipeStore{inFlight: make(map[string]*pipeFetch)}
+}
+
+// sharedPipes is process-wide so concurrent requests across different API
+// calls (not just goroutines within one call) can join the same in-flight
+// fetch for a track.
+var sharedPipes = newPipeStore()
+
+// runDownloadDeduped runs fn (a single backend download call that writes
+// into outputDir) under dedup for key. onProgress, if non-nil, is called
+// with the growing byte count regardless of whether this caller ends up
+// leading the download or following someone else's.
+func (p *pipeStore) runDownloadDeduped(key, outputDir string, onProgress func(bytesWritten int64), fn func() (string, error)) (string, error) {
+	p.mu.Lock()
+	if existing, ok := p.inFlight[key]; ok {
+		p.mu.Unlock()
+		leaderPath, err := existing.wait(onProgress)
+		if err != nil {
+			return "", err
+		}
+		return copyIntoDir(leaderPath, outputDir)
+	}
+
+	fetch := newPipeFetch(outputDir)
+	p.inFlight[key] = fetch
+	p.mu.Unlock()
+
+	stop := make(chan struct{})
+	go fetch.pollUntilDone(stop)
+
+	var progressDone chan struct{}
+	if onProgress != nil {
+		progressDone = make(chan struct{})
+		go func() {
+			_, _ = fetch.wait(onProgress)
+			close(progressDone)
+		}()
+	}
+
+	path, err := fn()
+	close(stop)
+	fetch.finish(path, err)
+	if progressDone != nil {
+		<-progressDone
+	}
+
+	p.mu.Lock()
+	delete(p.inFlight, key)
+	p.mu.Unlock()
+
+	if onProgress != nil {
+		onProgress(dirSize(outputDir))
+	}
+
+	return path, err
+}
+
+// dirSize sums the size of every regular file directly inside dir,
+// tolerating a directory that doesn't exist yet (the downloader may not
+// have created it the moment polling starts).
+func dirSize(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// copyIntoDir copies srcPath into destDir under its own base name, creating
+// destDir if needed, and returns the new path.
+func copyIntoDir(srcPath, destDir string) (string, error) {
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return "", err
+	}
+
+	destPath := filepath.Join(destDir, filepath.Base(srcPath))
+	if _, err := copyFile(srcPath, destPath); err != nil {
+		return "", err
+	}
+
+	return destPath, nil
+}
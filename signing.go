@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type downloadMode string
+
+const (
+	modeToken  downloadMode = "token"
+	modeSigned downloadMode = "signed"
+)
+
+// parseDownloadMode validates a request's raw mode string, defaulting an
+// empty value to modeToken so existing callers that predate signed mode
+// keep working unchanged.
+func parseDownloadMode(raw string) (downloadMode, error) {
+	switch downloadMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", modeToken:
+		return modeToken, nil
+	case modeSigned:
+		return modeSigned, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q: must be \"token\" or \"signed\"", raw)
+	}
+}
+
+// signDownloadPath returns a base64url HMAC-SHA256 signature over
+// (spotifyID, service, exp), so a download URL built from it is
+// self-verifying: any instance holding the same DOWNLOAD_SIGNING_KEY can
+// validate it without a shared server-side token store.
+func signDownloadPath(key []byte, spotifyID, service string, exp int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%s:%d", spotifyID, service, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDownloadPath reports an error if sig is not a valid, unexpired
+// signature for (spotifyID, service, exp). The comparison runs in constant
+// time so a mistyped signature can't be brute-forced byte-by-byte via
+// response timing.
+func verifyDownloadPath(key []byte, spotifyID, service string, exp int64, sig string) error {
+	if time.Now().Unix() > exp {
+		return fmt.Errorf("signed URL has expired")
+	}
+
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+
+	expected, err := base64.RawURLEncoding.DecodeString(signDownloadPath(key, spotifyID, service, exp))
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(given, expected) != 1 {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// signedDownloadResponse builds a createDownloadResponse for mode "signed".
+// Signed mode has no server-side token store, so instead of minting a token
+// into downloadStore it hands back a URL that embeds its own expiry and
+// HMAC signature; any instance sharing DOWNLOAD_SIGNING_KEY and the cache's
+// backing directory can serve it. That means the file it points to must
+// live at the persistent, content-addressable path the cache already
+// manages (keyed by spotify_id + service) rather than in this request's own
+// ephemeral work directory - so this also requires the result cache to
+// have a fresh entry for spotifyID, which resolveWithFallback already wrote
+// through on a successful download. Either way, the per-request copy at
+// downloadPath is no longer needed once that check is done, so it's always
+// cleaned up before returning.
+//
+// include_lyrics is intentionally not supported in signed mode: applying it
+// would mean rewriting hit.Path, the single canonical file every caller's
+// signed URL points at and that cache.get() may be serving to a concurrent
+// request right now - there's no private copy to embed into the way token
+// mode has. Use mode "token" for include_lyrics.
+func (s *apiServer) signedDownloadResponse(r *http.Request, spotifyID, service string, downloadPath string, attempts []attempt, includeLyrics bool, ttl time.Duration) (createDownloadResponse, error) {
+	defer func() { _ = os.RemoveAll(filepath.Dir(filepath.Dir(downloadPath))) }()
+
+	hit, ok := s.cache.get(spotifyID, service)
+	if !ok {
+		return createDownloadResponse{}, fmt.Errorf("signed mode requires a cached copy of the download, but none was found")
+	}
+
+	exp := time.Now().Add(ttl).Unix()
+	sig := signDownloadPath(s.signingKey, spotifyID, hit.Service, exp)
+	downloadURL := fmt.Sprintf("%s/v1/download/%s/%s?exp=%d&sig=%s", s.publicBaseURL(r), spotifyID, hit.Service, exp, sig)
+
+	resp := createDownloadResponse{
+		OK:          true,
+		SpotifyID:   spotifyID,
+		Service:     hit.Service,
+		Filename:    filepath.Base(hit.Path),
+		DownloadURL: downloadURL,
+		ExpiresAt:   time.Unix(exp, 0).UTC(),
+		Attempts:    attempts,
+	}
+	if includeLyrics {
+		resp.LyricsError = "include_lyrics is not supported with mode \"signed\": use mode \"token\" instead"
+	}
+
+	return resp, nil
+}
+
+// handleSignedDownload serves GET /v1/download/{spotify_id}/{service}, the
+// signed-mode counterpart to handleDownloadByTokenValue: it verifies exp/sig
+// itself rather than looking up a token, then serves directly from the
+// cache's content-addressable copy for (spotifyID, service).
+func (s *apiServer) handleSignedDownload(w http.ResponseWriter, r *http.Request, spotifyID, service string) {
+	if len(s.signingKey) == 0 {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{OK: false, Error: "signed downloads are disabled: DOWNLOAD_SIGNING_KEY is not configured"})
+		return
+	}
+
+	query := r.URL.Query()
+	exp, err := strconv.ParseInt(strings.TrimSpace(query.Get("exp")), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "invalid or missing exp"})
+		return
+	}
+
+	if err := verifyDownloadPath(s.signingKey, spotifyID, service, exp, query.Get("sig")); err != nil {
+		writeJSON(w, http.StatusForbidden, errorResponse{OK: false, Error: err.Error()})
+		return
+	}
+
+	hit, ok := s.cache.get(spotifyID, service)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{OK: false, Error: "cached file not found"})
+		return
+	}
+
+	serveDownloadFile(w, r, hit.Path)
+}
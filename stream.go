@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"spotiflacapi/matcher"
+)
+
+// handleDownloadURLStream is a GET/EventSource-friendly counterpart to
+// POST /v1/download-url: instead of waiting silently for the whole
+// resolution to finish, it streams a "service_attempt" event per service
+// tried, a "download_progress" event whenever the in-flight download's
+// output directory grows, and then a final "resolved" or "failed" event.
+//
+// download_progress is necessarily coarse: the vendored backend's
+// downloaders take an output directory and return only once the whole file
+// is written, with no in-process hook to push bytes-done as they're
+// produced. resolveWithFallback's pipeStore (see pipestore.go) works around
+// that by polling the growing output directory's total size on a ticker, so
+// the granularity here is "however often that poll observes growth", not a
+// true per-chunk callback from the downloader itself.
+func (s *apiServer) handleDownloadURLStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{OK: false, Error: "method not allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	spotifyURL := strings.TrimSpace(query.Get("spotify_url"))
+	if spotifyURL == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "spotify_url is required"})
+		return
+	}
+
+	var services []string
+	if raw := strings.TrimSpace(query.Get("services")); raw != "" {
+		services = strings.Split(raw, ",")
+	}
+	serviceOrder := normalizeServiceOrder(services)
+	if len(serviceOrder) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "no valid services in services"})
+		return
+	}
+
+	ttl := s.ttl
+	if ttlSeconds, err := strconv.Atoi(strings.TrimSpace(query.Get("ttl_seconds"))); err == nil && ttlSeconds > 0 {
+		override := time.Duration(ttlSeconds) * time.Second
+		if override > 24*time.Hour {
+			override = 24 * time.Hour
+		}
+		ttl = override
+	}
+
+	var minScore float64
+	if raw := strings.TrimSpace(query.Get("min_score")); raw != "" {
+		var err error
+		if minScore, err = strconv.ParseFloat(raw, 64); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "invalid min_score"})
+			return
+		}
+	}
+
+	var maxDurationDeltaMs int
+	if raw := strings.TrimSpace(query.Get("max_duration_delta_ms")); raw != "" {
+		var err error
+		if maxDurationDeltaMs, err = strconv.Atoi(raw); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{OK: false, Error: "invalid max_duration_delta_ms"})
+			return
+		}
+	}
+
+	matchCfg := matcher.Config{MinScore: minScore, MaxDurationDeltaMs: maxDurationDeltaMs}
+
+	includeLyrics := query.Get("include_lyrics") == "true" || query.Get("include_lyrics") == "1"
+	lyricsFormat := query.Get("lyrics_format")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{OK: false, Error: "streaming not supported"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeSSEEvent(w, flusher, "started", map[string]any{"services": serviceOrder})
+
+	onAttempt := func(a attempt) {
+		writeSSEEvent(w, flusher, "service_attempt", a)
+	}
+
+	onProgress := func(service string, bytesWritten int64) {
+		writeSSEEvent(w, flusher, "download_progress", map[string]any{"service": service, "bytes_written": bytesWritten})
+	}
+
+	downloadPath, serviceUsed, spotifyID, meta, _, err := resolveWithFallback(r.Context(), spotifyURL, serviceOrder, matchCfg, s.cache, onAttempt, onProgress)
+	if err != nil {
+		writeSSEEvent(w, flusher, "failed", map[string]any{"error": err.Error()})
+		return
+	}
+
+	lyricsResult, lyricsErr := applyLyricsIfRequested(downloadPath, meta, spotifyID, includeLyrics, lyricsFormat)
+	if lyricsErr != "" {
+		writeSSEEvent(w, flusher, "lyrics_failed", map[string]any{"error": lyricsErr})
+	}
+
+	entry, err := s.store.put(downloadPath, serviceUsed, spotifyID, ttl)
+	if err != nil {
+		writeSSEEvent(w, flusher, "failed", map[string]any{"error": "failed to generate download token"})
+		return
+	}
+
+	var lrcDownloadURL string
+	if lyricsResult != nil && lyricsResult.LRCPath != "" {
+		if lrcEntry, err := s.store.put(lyricsResult.LRCPath, serviceUsed, spotifyID, ttl); err == nil {
+			lrcDownloadURL = fmt.Sprintf("%s/v1/download/%s", s.publicBaseURL(r), lrcEntry.Token)
+		}
+	}
+
+	writeSSEEvent(w, flusher, "resolved", createDownloadResponse{
+		OK:             true,
+		SpotifyID:      spotifyID,
+		Service:        serviceUsed,
+		Filename:       filepath.Base(entry.Path),
+		DownloadURL:    fmt.Sprintf("%s/v1/download/%s", s.publicBaseURL(r), entry.Token),
+		ExpiresAt:      entry.ExpiresAt.UTC(),
+		Lyrics:         lyricsResult,
+		LRCDownloadURL: lrcDownloadURL,
+	})
+}
+
+// writeSSEEvent writes a single Server-Sent Events frame and flushes it
+// immediately so the client sees it as soon as it's produced, rather than
+// buffered until the handler returns.
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	flusher.Flush()
+}